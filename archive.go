@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+// archiveWindow extends a State with a sampled historical block range, so
+// the archive-workload generators below can target old blocks instead of
+// only the current head that stateProducer.Refresh publishes. It embeds
+// State so it satisfies the interface itself and every other generator can
+// keep using it unmodified.
+type archiveWindow struct {
+	State
+	From, To uint64
+}
+
+// mainnetHeadEstimate bounds the block numbers archive queries sample from.
+// It doesn't need to track the real chain head precisely: it just needs to
+// land requests inside the range archive nodes actually have data for.
+const mainnetHeadEstimate = 18_000_000
+
+// withArchiveWindow samples a [From, To] block window using s's own
+// randomness source and wraps s so archive generators can read it back.
+func withArchiveWindow(s State) State {
+	from := uint64(s.RandInt64()) % mainnetHeadEstimate
+	width := uint64(s.RandInt64())%9_900 + 100 // 100-9999 block window
+	return &archiveWindow{State: s, From: from, To: from + width}
+}
+
+// windowOf returns the block window carried by s if it was wrapped with
+// withArchiveWindow, or samples a fresh one otherwise so these generators
+// still work when registered without --workload archive/mixed.
+func windowOf(s State) (from, to uint64) {
+	if aw, ok := s.(*archiveWindow); ok {
+		return aw.From, aw.To
+	}
+	w := withArchiveWindow(s).(*archiveWindow)
+	return w.From, w.To
+}
+
+// randHash fabricates a pseudo-random 32 byte hash from s's randomness
+// source, for archive methods (debug_traceTransaction) that need a
+// plausible-looking transaction hash but have no real one to sample from in
+// this generator.
+func randHash(s State) string {
+	b := make([]byte, 32)
+	for i := 0; i < len(b); i += 8 {
+		v := uint64(s.RandInt64())
+		for j := 0; j < 8 && i+j < len(b); j++ {
+			b[i+j] = byte(v >> (8 * j))
+		}
+	}
+	return "0x" + hex.EncodeToString(b)
+}
+
+// installWorkloadDefaults adds the archive-tier generators, weighted per
+// --workload so users can characterize archive-node performance without
+// hand-tuning --method weights themselves. For "archive" the caller skips
+// installDefaults entirely so the run is archive-only; "mixed" blends these
+// in on top of the head-profile table installDefaults already installed.
+func installWorkloadDefaults(g *generator, workload string) {
+	switch workload {
+	case "archive":
+		g.Add(RandomQuery{Method: "eth_getLogs", Weight: 4000, Generate: genEthGetLogsArchive})
+		g.Add(RandomQuery{Method: "eth_call", Weight: 3000, Generate: genEthCallArchive})
+		g.Add(RandomQuery{Method: "debug_traceTransaction", Weight: 2000, Generate: genDebugTraceTransaction})
+		g.Add(RandomQuery{Method: "debug_traceCall", Weight: 1500, Generate: genDebugTraceCall})
+		g.Add(RandomQuery{Method: "trace_block", Weight: 1500, Generate: genTraceBlock})
+	case "mixed":
+		g.Add(RandomQuery{Method: "eth_getLogs", Weight: 400, Generate: genEthGetLogsArchive})
+		g.Add(RandomQuery{Method: "eth_call", Weight: 300, Generate: genEthCallArchive})
+		g.Add(RandomQuery{Method: "debug_traceTransaction", Weight: 200, Generate: genDebugTraceTransaction})
+		g.Add(RandomQuery{Method: "debug_traceCall", Weight: 150, Generate: genDebugTraceCall})
+		g.Add(RandomQuery{Method: "trace_block", Weight: 150, Generate: genTraceBlock})
+	case "head", "":
+		// installDefaults already installed a head-only weight table.
+	}
+}
+
+// genEthGetLogsArchive requests logs over a wide historical block range,
+// the shape that stresses an archive node's log index rather than its head
+// cache.
+func genEthGetLogsArchive(w io.Writer, s State) error {
+	from, to := windowOf(s)
+	_, err := fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%d,"method":"eth_getLogs","params":[{"fromBlock":"0x%x","toBlock":"0x%x"}]}`,
+		s.RandInt64(), from, to)
+	return err
+}
+
+// genEthCallArchive is an eth_call pinned to a historical blockNumber
+// instead of "latest", forcing the provider to serve it from archive state.
+func genEthCallArchive(w io.Writer, s State) error {
+	from, _ := windowOf(s)
+	_, err := fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%d,"method":"eth_call","params":[{"to":"%s"},"0x%x"]}`,
+		s.RandInt64(), randHash(s)[:42], from)
+	return err
+}
+
+// genDebugTraceTransaction requests a call trace for a (fabricated) historic
+// transaction, one of the heaviest calls an archive node serves.
+func genDebugTraceTransaction(w io.Writer, s State) error {
+	_, err := fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%d,"method":"debug_traceTransaction","params":["%s",{"tracer":"callTracer"}]}`,
+		s.RandInt64(), randHash(s))
+	return err
+}
+
+// genDebugTraceCall traces a synthetic call against a historical block,
+// combining the eth_call and debug_traceTransaction archive-load shapes.
+func genDebugTraceCall(w io.Writer, s State) error {
+	from, _ := windowOf(s)
+	_, err := fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%d,"method":"debug_traceCall","params":[{"to":"%s"},"0x%x",{"tracer":"callTracer"}]}`,
+		s.RandInt64(), randHash(s)[:42], from)
+	return err
+}
+
+// genTraceBlock requests a full block trace (Parity/OpenEthereum style),
+// another archive-heavy method not covered by the default method table.
+func genTraceBlock(w io.Writer, s State) error {
+	from, _ := windowOf(s)
+	_, err := fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%d,"method":"trace_block","params":["0x%x"]}`,
+		s.RandInt64(), from)
+	return err
+}
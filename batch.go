@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// batchErrors counts JSON-RPC errors returned for individual elements of a
+// batch, tracked separately from counter since those requests were still
+// successfully sent and answered.
+var batchErrors int64
+
+// batchSizer decides how many inner calls go into the next batch.
+type batchSizer func(s State) int
+
+// newBatchSizer builds a batchSizer from --batch-size / --batch-size-dist.
+// A fixed size always returns size; "poisson:8" samples a batch size from a
+// Poisson distribution with mean 8 using Knuth's algorithm, so batches
+// vary the way real client libraries vary theirs.
+func newBatchSizer(size int, dist string) (batchSizer, error) {
+	if dist == "" {
+		if size <= 0 {
+			return nil, nil
+		}
+		return func(State) int { return size }, nil
+	}
+
+	parts := strings.SplitN(dist, ":", 2)
+	if len(parts) != 2 || parts[0] != "poisson" {
+		return nil, fmt.Errorf("unsupported --batch-size-dist %q, want poisson:<mean>", dist)
+	}
+	mean, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid poisson mean in --batch-size-dist %q: %w", dist, err)
+	}
+
+	return func(s State) int {
+		return poisson(mean, s.RandInt64)
+	}, nil
+}
+
+// poisson samples from a Poisson(mean) distribution using Knuth's algorithm,
+// driven by randInt64 so callers share the generator's randomness source.
+func poisson(mean float64, randInt64 func() int64) int {
+	l := math.Exp(-mean)
+	k := 0
+	p := 1.0
+	for {
+		k++
+		p *= float64(randInt64()%1_000_000) / 1_000_000
+		if p <= l {
+			return k - 1
+		}
+	}
+}
+
+// genBatch packs n inner calls from gen into a single JSON-RPC batch array,
+// weighted-selected the same way a single call would be, and returns the
+// method of each inner call for per-method rate limiting and logging.
+func genBatch(gen *generator, w io.Writer, s State, n int) ([]string, error) {
+	if n <= 0 {
+		n = 1
+	}
+
+	methods := make([]string, 0, n)
+	if _, err := io.WriteString(w, "["); err != nil {
+		return nil, err
+	}
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return nil, err
+			}
+		}
+		method, err := gen.Query(w, s)
+		if err != nil {
+			return nil, err
+		}
+		methods = append(methods, method)
+	}
+	if _, err := io.WriteString(w, "]"); err != nil {
+		return nil, err
+	}
+
+	return methods, nil
+}
+
+// rpcResult is just enough of a JSON-RPC response to tell success from
+// per-element failure without decoding the full result payload.
+type rpcResult struct {
+	Error *json.RawMessage `json:"error"`
+}
+
+// queryBatch POSTs a JSON-RPC batch to endpoint, incrementing counter once
+// per successful element and batchErrors once per element that came back
+// with a JSON-RPC error. methods holds the method of each inner call, as
+// returned by genBatch, and is fed into the same Prometheus vectors query()
+// uses so batched traffic shows up on /metrics like any other request.
+func queryBatch(endpoint string, methods []string, queryBuf *bytes.Buffer) {
+	inFlight.Inc()
+	defer inFlight.Dec()
+
+	start := time.Now()
+	resp, err := http.Post(endpoint, "application/json", queryBuf)
+	if err != nil {
+		errorsTotal.WithLabelValues(classifyErr(err)).Inc()
+		log.Printf("batch error: %s\n", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	httpStatusTotal.WithLabelValues(strconv.Itoa(resp.StatusCode)).Inc()
+	if resp.StatusCode >= 500 {
+		errorsTotal.WithLabelValues("5xx").Inc()
+	}
+
+	var results []rpcResult
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		log.Printf("failed to decode batch response: %s\n", err)
+		return
+	}
+
+	// Only measured once the full batch body is decoded, not right after
+	// http.Post returns, so decode time is attributed to the histogram too.
+	// The server answered the batch as a whole in elapsed; attribute that
+	// evenly across the elements it contained for the per-method histogram.
+	elapsed := time.Since(start)
+	perElement := elapsed
+	if len(results) > 0 {
+		perElement = elapsed / time.Duration(len(results))
+	}
+
+	for i, r := range results {
+		method := "batch"
+		if i < len(methods) {
+			method = methods[i]
+		}
+		requestDuration.WithLabelValues(method).Observe(perElement.Seconds())
+
+		if r.Error != nil {
+			atomic.AddInt64(&batchErrors, 1)
+			errorsTotal.WithLabelValues(rpcErrorClass(r.Error)).Inc()
+		} else {
+			atomic.AddInt64(&counter, 1)
+			requestsTotal.WithLabelValues(method).Inc()
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import "testing"
+
+func TestPoissonMeanIsApproximatelyCorrect(t *testing.T) {
+	var randState int64 = 1
+	randInt64 := func() int64 {
+		// A small deterministic LCG so the test doesn't depend on math/rand.
+		randState = (randState*1103515245 + 12345) & 0x7fffffff
+		return randState
+	}
+
+	const mean = 8.0
+	const samples = 20000
+	var total int64
+	for i := 0; i < samples; i++ {
+		k := poisson(mean, randInt64)
+		if k < 0 {
+			t.Fatalf("poisson() returned a negative sample: %d", k)
+		}
+		total += int64(k)
+	}
+
+	got := float64(total) / samples
+	if got < mean*0.9 || got > mean*1.1 {
+		t.Fatalf("poisson(%v) sample mean = %v, want within 10%% of %v", mean, got, mean)
+	}
+}
+
+func TestNewBatchSizerFixedSize(t *testing.T) {
+	sizer, err := newBatchSizer(5, "")
+	if err != nil {
+		t.Fatalf("newBatchSizer: %s", err)
+	}
+	if sizer == nil {
+		t.Fatal("newBatchSizer with size>0 should return a non-nil sizer")
+	}
+	if got := sizer(nil); got != 5 {
+		t.Fatalf("fixed batchSizer returned %d, want 5", got)
+	}
+}
+
+func TestNewBatchSizerNoneConfigured(t *testing.T) {
+	sizer, err := newBatchSizer(0, "")
+	if err != nil {
+		t.Fatalf("newBatchSizer: %s", err)
+	}
+	if sizer != nil {
+		t.Fatal("newBatchSizer with no size or dist should return a nil sizer")
+	}
+}
+
+func TestNewBatchSizerRejectsUnknownDist(t *testing.T) {
+	if _, err := newBatchSizer(0, "gaussian:8"); err == nil {
+		t.Fatal("newBatchSizer should reject a --batch-size-dist it doesn't recognize")
+	}
+}
+
+func TestNewBatchSizerRejectsBadPoissonMean(t *testing.T) {
+	if _, err := newBatchSizer(0, "poisson:not-a-number"); err == nil {
+		t.Fatal("newBatchSizer should reject a non-numeric poisson mean")
+	}
+}
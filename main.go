@@ -8,7 +8,6 @@ import (
 	"io"
 	"log"
 	"math/rand"
-	"net/http"
 	"os"
 	"sort"
 	"sync/atomic"
@@ -23,9 +22,20 @@ var Version = "dev"
 
 // Options contains the flag options
 type Options struct {
-	Methods      map[string]int64 `short:"m" long:"method" description:"A map from json rpc methods to their weight" default:"eth_getCode:100" default:"eth_getLogs:250" default:"eth_getTransactionByHash:250" default:"eth_blockNumber:350" default:"eth_getTransactionCount:400" default:"eth_getBlockByNumber:400" default:"eth_getBalance:550" default:"eth_getTransactionReceipt:600" default:"eth_call:2000"`
-	Web3Endpoint string           `long:"rpc" description:"Ethereum JSONRPC provider, such as Infura or Cloudflare" default:"https://mainnet.infura.io/v3/af500e495f2d4e7cbcae36d0bfa66bcb"` // Versus API key on Infura
-	RateLimit    float64          `short:"r" long:"ratelimit" description:"rate limit for generating jsonrpc calls"`
+	Methods              map[string]int64   `short:"m" long:"method" description:"A map from json rpc methods to their weight" default:"eth_getCode:100" default:"eth_getLogs:250" default:"eth_getTransactionByHash:250" default:"eth_blockNumber:350" default:"eth_getTransactionCount:400" default:"eth_getBlockByNumber:400" default:"eth_getBalance:550" default:"eth_getTransactionReceipt:600" default:"eth_call:2000"`
+	Web3Endpoint         string             `long:"rpc" description:"Ethereum JSONRPC provider, such as Infura or Cloudflare" default:"https://mainnet.infura.io/v3/af500e495f2d4e7cbcae36d0bfa66bcb"` // Versus API key on Infura
+	RateLimit            float64            `short:"r" long:"ratelimit" description:"rate limit for generating jsonrpc calls"`
+	RateLimitAlgo        string             `long:"ratelimit-algo" description:"rate limiting algorithm to apply: token (bursty) or leaky (smoothed)" default:"token"`
+	MethodRateLimits     map[string]float64 `long:"ratelimit-method" description:"Per-method rate caps, e.g. eth_call:500"`
+	RateLimitCoordinator string             `long:"ratelimit-coordinator" description:"address of a shared ratelimit coordinator (see --ratelimit-serve) to enforce one aggregate rate across multiple ethspam processes"`
+	RateLimitServe       string             `long:"ratelimit-serve" description:"run as a ratelimit coordinator on this address instead of generating queries, enforcing --ratelimit/--ratelimit-method for every connected ethspam process"`
+	Transport            string             `long:"transport" description:"transport to send generated queries over" choice:"http" choice:"ws" choice:"both" default:"http"`
+	HTTPEndpoint         string             `long:"rpc-http" description:"HTTP JSONRPC endpoint for the http half of --transport=both; defaults to --rpc with its ws/wss scheme translated to http/https"`
+	BatchSize            int                `long:"batch-size" description:"pack this many weighted-random calls into one JSON-RPC batch request"`
+	BatchSizeDist        string             `long:"batch-size-dist" description:"sample the batch size from a distribution instead of a fixed --batch-size, e.g. poisson:8"`
+	ShadowRPC            []string           `long:"shadow-rpc" description:"additional JSONRPC endpoint to send every query to and diff the response against --rpc (repeatable)"`
+	MetricsAddr          string             `long:"metrics-addr" description:"serve Prometheus metrics (per-method counters, latency histograms, error classes) at /metrics on this address"`
+	Workload             string             `long:"workload" description:"query profile: head-only, archive-heavy, or a blend of both" choice:"head" choice:"archive" choice:"mixed" default:"head"`
 
 	Version bool `long:"version" description:"Print version and exit."`
 }
@@ -50,11 +60,32 @@ func main() {
 		os.Exit(0)
 	}
 
+	if options.MetricsAddr != "" {
+		go serveMetrics(options.MetricsAddr)
+	}
+
+	if options.RateLimitServe != "" {
+		local, err := newLimiter(options)
+		if err != nil {
+			exit(1, "failed to build coordinator ratelimit: %s", err)
+		}
+		if err := serveRateLimitCoordinator(context.Background(), options.RateLimitServe, local); err != nil {
+			exit(1, "ratelimit coordinator exited: %s", err)
+		}
+		return
+	}
+
 	gen := generator{}
-	err = installDefaults(&gen, options.Methods)
-	if err != nil {
-		exit(1, "failed to install defaults: %s", err)
+	// --workload=archive characterizes archive-tier performance in
+	// isolation, so it skips the head-profile method table entirely
+	// instead of blending it in underneath the archive generators.
+	if options.Workload != "archive" {
+		err = installDefaults(&gen, options.Methods)
+		if err != nil {
+			exit(1, "failed to install defaults: %s", err)
+		}
 	}
+	installWorkloadDefaults(&gen, options.Workload)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -106,15 +137,66 @@ func main() {
 		}
 	}()
 
-	// var rlimit *rate.Limiter
-	// if options.RateLimit != 0 {
-	// 	rlimit = rate.NewLimiter(rate.Limit(options.RateLimit), 10)
-	// }
+	rlimit, err := newLimiter(options)
+	if err != nil {
+		exit(1, "failed to build ratelimit: %s", err)
+	}
+
+	// httpRPCEndpoint is what non-websocket workers POST to. Under
+	// --transport=both, options.Web3Endpoint is required to be ws:// or
+	// wss:// (for the websocket half and the subscription manager), so the
+	// plain-http half needs its own endpoint instead of reusing that URL.
+	httpRPCEndpoint := options.Web3Endpoint
+
+	if options.Transport != "http" {
+		if !isWebsocketEndpoint(options.Web3Endpoint) {
+			exit(1, "--transport=%s requires a ws:// or wss:// --rpc endpoint", options.Transport)
+		}
+		go runSubscriptions(ctx, options.Web3Endpoint)
+
+		if options.Transport == "both" {
+			var err error
+			httpRPCEndpoint, err = httpEndpoint(options.Web3Endpoint, options.HTTPEndpoint)
+			if err != nil {
+				exit(1, "failed to resolve an http endpoint for --transport=both: %s", err)
+			}
+		}
+	}
+
+	batchSize, err := newBatchSizer(options.BatchSize, options.BatchSizeDist)
+	if err != nil {
+		exit(1, "failed to configure batching: %s", err)
+	}
+	if batchSize != nil && options.Transport != "http" {
+		exit(1, "--batch-size is only supported with --transport=http")
+	}
+	if len(options.ShadowRPC) > 0 && (batchSize != nil || options.Transport != "http") {
+		exit(1, "--shadow-rpc is only supported with --transport=http and without --batch-size")
+	}
 
 	const numWorkers = 250
 
+	var wsTransportPool *wsTransport
+	if options.Transport != "http" {
+		// --transport=both only sends half the workers (i%2==0) over ws;
+		// size the connection pool to match instead of always opening
+		// numWorkers sockets.
+		wsWorkers := numWorkers
+		if options.Transport == "both" {
+			wsWorkers = (numWorkers + 1) / 2
+		}
+		wsTransportPool, err = newWSTransport(ctx, options.Web3Endpoint, wsWorkers)
+		if err != nil {
+			exit(1, "failed to open websocket transport: %s", err)
+		}
+	}
+
 	for i := 0; i < numWorkers; i++ {
-		go func() {
+		// For --transport=both, fan workers out proportionally across both
+		// transports so mixed workloads can be benchmarked in one run.
+		useWS := options.Transport == "ws" || (options.Transport == "both" && i%2 == 0)
+
+		go func(i int, useWS bool) {
 			buf := &bytes.Buffer{}
 			state := <-stateChannel
 
@@ -126,26 +208,64 @@ func main() {
 					return
 				default:
 				}
-				// if rlimit != nil {
-				// 	rlimit.Wait(context.Background())
-				// }
 
-				if err := gen.Query(buf, state); err == io.EOF {
+				queryState := state
+				if options.Workload != "head" {
+					queryState = withArchiveWindow(queryState)
+				}
+
+				if batchSize != nil {
+					methods, err := genBatch(&gen, buf, queryState, batchSize(queryState))
+					if err == io.EOF {
+						fmt.Println("query gen EOF")
+						return
+					} else if err != nil {
+						exit(2, "failed to write generated batch: %s", err)
+					} else {
+						for _, method := range methods {
+							if err := rlimit.Wait(ctx, method); err != nil {
+								return
+							}
+						}
+						queryBatch(options.Web3Endpoint, methods, buf)
+					}
+					buf.Reset()
+					continue
+				}
+
+				method, err := gen.Query(buf, queryState)
+				if err == io.EOF {
 					// Done
 					fmt.Println("query gen EOF")
 					return
 				} else if err != nil {
 					exit(2, "failed to write generated query: %s", err)
 				} else {
-					query(options.Web3Endpoint, buf)
+					if err := rlimit.Wait(ctx, method); err != nil {
+						return
+					}
+					if useWS {
+						wsTransportPool.query(buf)
+					} else if len(options.ShadowRPC) > 0 {
+						queryShadow(options.Web3Endpoint, method, options.ShadowRPC, buf)
+					} else {
+						query(httpRPCEndpoint, method, buf)
+					}
 				}
 
 				buf.Reset()
 			}
-		}()
+		}(i, useWS)
+	}
+
+	// --metrics-addr exposes all of this (and more, per-method) on /metrics;
+	// keep the stdout summary only for runs that didn't ask for it; printing
+	// both would just be the same numbers twice.
+	if options.MetricsAddr != "" {
+		select {}
 	}
 
-	var prevCounter int64
+	var prevCounter, prevWSNotifications int64
 
 	for {
 		currentCounter := atomic.LoadInt64(&counter)
@@ -154,6 +274,20 @@ func main() {
 
 		log.Printf("req/s :: %d\n", reqsPerSecond)
 
+		if options.Transport != "http" {
+			currentWSNotifications := atomic.LoadInt64(&wsNotifications)
+			log.Printf("ws notifications/s :: %d\n", currentWSNotifications-prevWSNotifications)
+			prevWSNotifications = currentWSNotifications
+		}
+
+		if batchSize != nil {
+			log.Printf("batch errors so far :: %d\n", atomic.LoadInt64(&batchErrors))
+		}
+
+		if len(options.ShadowRPC) > 0 {
+			log.Printf("mismatches so far :: %d\n", atomic.LoadInt64(&mismatches))
+		}
+
 		if counter%100 == 0 {
 			log.Printf("sent %d requests\n", counter)
 		}
@@ -164,17 +298,6 @@ func main() {
 
 var counter int64
 
-func query(endpoint string, queryBuf *bytes.Buffer) {
-	// log.Println(queryBuf.String())
-
-	resp, err := http.Post(endpoint, "application/json", queryBuf)
-	if err != nil {
-		log.Printf("error: %s, status code: %d\n", err.Error(), resp.StatusCode)
-	}
-
-	atomic.AddInt64(&counter, 1)
-}
-
 type Generator func(io.Writer, State) error
 
 type RandomQuery struct {
@@ -204,10 +327,10 @@ func (g *generator) Add(query RandomQuery) {
 }
 
 // Query selects a generator based on proportonal weighted probability and
-// writes the query from the generator.
-func (g *generator) Query(w io.Writer, s State) error {
+// writes the query from the generator, returning the method it generated.
+func (g *generator) Query(w io.Writer, s State) (string, error) {
 	if len(g.queries) == 0 {
-		return errors.New("no query generators available")
+		return "", errors.New("no query generators available")
 	}
 
 	weight := s.RandInt64() % g.totalWeight
@@ -217,7 +340,7 @@ func (g *generator) Query(w io.Writer, s State) error {
 		// TODO: Test for off-by-one
 		current += q.Weight
 		if current >= weight {
-			return q.Generate(w, s)
+			return q.Method, q.Generate(w, s)
 		}
 	}
 
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// latencyBuckets covers the range a JSON-RPC call reasonably takes, from a
+// fast local node (1ms) out to a slow, overloaded archive node (30s).
+var latencyBuckets = []float64{
+	0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5,
+	1, 2.5, 5, 10, 20, 30,
+}
+
+var (
+	requestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ethspam_requests_total",
+		Help: "Successful JSON-RPC requests sent, by method.",
+	}, []string{"method"})
+
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "ethspam_request_duration_seconds",
+		Help:    "Latency of a JSON-RPC request from http.Post to fully read response, by method.",
+		Buckets: latencyBuckets,
+	}, []string{"method"})
+
+	httpStatusTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ethspam_http_status_total",
+		Help: "HTTP responses received, by status code.",
+	}, []string{"status"})
+
+	errorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ethspam_errors_total",
+		Help: "Errors encountered sending requests, by class (dial, timeout, 5xx, mismatch, rpc_error_<code>).",
+	}, []string{"class"})
+
+	inFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "ethspam_requests_in_flight",
+		Help: "Requests currently awaiting a response.",
+	})
+
+	// wsQueriesTotal and wsNotificationsTotal cover the websocket transport
+	// (ws.go). They're dedicated counters rather than reusing requestsTotal/
+	// requestDuration: a ws query is written to a shared, persistent
+	// connection and its response is read back by an independent drain
+	// loop, so there's no cheap way to correlate a given response (or its
+	// latency) back to the write that produced it the way there is for a
+	// single request/response HTTP round trip.
+	wsQueriesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ethspam_ws_queries_total",
+		Help: "Queries written to the websocket transport, by outcome (sent, error).",
+	}, []string{"outcome"})
+
+	wsNotificationsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "ethspam_ws_notifications_total",
+		Help: "eth_subscribe notifications received over persistent websocket connections.",
+	})
+)
+
+// serveMetrics exposes the collectors above at /metrics on addr. It runs
+// for the lifetime of the process; a failure here is fatal since a metrics
+// endpoint that silently stopped serving would be worse than none at all.
+func serveMetrics(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		exit(1, "metrics listener on %s failed: %s", addr, err)
+	}
+}
+
+// classifyErr buckets a request-level error (one that kept a response body
+// from ever coming back) into the "dial" or "timeout" error classes.
+func classifyErr(err error) string {
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		return "timeout"
+	}
+	return "dial"
+}
+
+// rpcErrorClass labels a JSON-RPC error by its .code, e.g. "rpc_error_-32601"
+// for method-not-found, so a provider-conformance dashboard can tell apart
+// error kinds (rate-limited vs unsupported vs malformed params) instead of
+// lumping every RPC-level error into one generic bucket.
+func rpcErrorClass(raw *json.RawMessage) string {
+	var e struct {
+		Code int `json:"code"`
+	}
+	if raw == nil || json.Unmarshal(*raw, &e) != nil || e.Code == 0 {
+		return "rpc_error"
+	}
+	return fmt.Sprintf("rpc_error_%d", e.Code)
+}
+
+// query POSTs queryBuf to endpoint, recording per-method request counts and
+// latency, HTTP status counts, and dial/timeout/5xx/rpc_error error classes.
+func query(endpoint string, method string, queryBuf *bytes.Buffer) {
+	inFlight.Inc()
+	defer inFlight.Dec()
+
+	start := time.Now()
+	resp, err := http.Post(endpoint, "application/json", queryBuf)
+	if err != nil {
+		errorsTotal.WithLabelValues(classifyErr(err)).Inc()
+		log.Printf("error: %s\n", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	httpStatusTotal.WithLabelValues(strconv.Itoa(resp.StatusCode)).Inc()
+	if resp.StatusCode >= 500 {
+		errorsTotal.WithLabelValues("5xx").Inc()
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Printf("error reading response: %s\n", err)
+		return
+	}
+
+	var result rpcResult
+	if err := json.Unmarshal(body, &result); err == nil && result.Error != nil {
+		errorsTotal.WithLabelValues(rpcErrorClass(result.Error)).Inc()
+	}
+
+	// Observed once body read and JSON parse are done, not right after
+	// http.Post returns, so slow decodes of large archive-tier payloads
+	// (debug_traceTransaction, trace_block) count toward the histogram.
+	requestDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+
+	requestsTotal.WithLabelValues(method).Inc()
+	atomic.AddInt64(&counter, 1)
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// RateLimitAlgo selects the shape of throttling applied to outgoing queries.
+type RateLimitAlgo string
+
+const (
+	// AlgoTokenBucket allows short bursts up to the configured burst size,
+	// refilling at a steady rate. Good for providers that tolerate spikes.
+	AlgoTokenBucket RateLimitAlgo = "token"
+	// AlgoLeaky meters requests at a steady rate over a one-second window,
+	// delaying (never rejecting) each request once the bucket is drained. A
+	// full bucket still lets up to one window's worth through at once.
+	AlgoLeaky RateLimitAlgo = "leaky"
+)
+
+// limiter throttles query generation, optionally on a per-method basis.
+type limiter interface {
+	// Wait blocks until a query for method is allowed to be sent, or
+	// ctx is done.
+	Wait(ctx context.Context, method string) error
+}
+
+// newLimiter builds a limiter from the parsed Options. A zero RateLimit,
+// empty MethodRateLimits and no RateLimitCoordinator means no limiting is
+// performed.
+func newLimiter(options Options) (limiter, error) {
+	if options.RateLimit == 0 && len(options.MethodRateLimits) == 0 && options.RateLimitCoordinator == "" {
+		return noopLimiter{}, nil
+	}
+
+	var l limiter
+	switch RateLimitAlgo(options.RateLimitAlgo) {
+	case AlgoLeaky:
+		l = newLeakyBucketLimiter(options.RateLimit, options.MethodRateLimits)
+	case AlgoTokenBucket, "":
+		l = newTokenBucketLimiter(options.RateLimit, options.MethodRateLimits)
+	default:
+		return nil, fmt.Errorf("unknown ratelimit-algo %q, want %q or %q", options.RateLimitAlgo, AlgoTokenBucket, AlgoLeaky)
+	}
+
+	if options.RateLimitCoordinator != "" {
+		dl, err := newDistributedLimiter(options.RateLimitCoordinator, l)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to ratelimit coordinator: %w", err)
+		}
+		return dl, nil
+	}
+
+	return l, nil
+}
+
+type noopLimiter struct{}
+
+func (noopLimiter) Wait(ctx context.Context, method string) error { return nil }
+
+// tokenBucketLimiter refills at a steady rate and allows bursts up to a
+// fixed size, via golang.org/x/time/rate.
+type tokenBucketLimiter struct {
+	global *rate.Limiter
+
+	mu      sync.Mutex
+	perMeth map[string]*rate.Limiter
+	caps    map[string]float64
+}
+
+func newTokenBucketLimiter(globalRate float64, methodCaps map[string]float64) *tokenBucketLimiter {
+	t := &tokenBucketLimiter{
+		perMeth: make(map[string]*rate.Limiter, len(methodCaps)),
+		caps:    methodCaps,
+	}
+	if globalRate > 0 {
+		t.global = rate.NewLimiter(rate.Limit(globalRate), burstFor(globalRate))
+	}
+	return t
+}
+
+func burstFor(r float64) int {
+	burst := int(r / 10)
+	if burst < 1 {
+		burst = 1
+	}
+	return burst
+}
+
+func (t *tokenBucketLimiter) Wait(ctx context.Context, method string) error {
+	if t.global != nil {
+		if err := t.global.Wait(ctx); err != nil {
+			return err
+		}
+	}
+
+	cap, ok := t.caps[method]
+	if !ok {
+		return nil
+	}
+
+	t.mu.Lock()
+	ml, ok := t.perMeth[method]
+	if !ok {
+		ml = rate.NewLimiter(rate.Limit(cap), burstFor(cap))
+		t.perMeth[method] = ml
+	}
+	t.mu.Unlock()
+
+	return ml.Wait(ctx)
+}
+
+// leakyBucketLimiter meters requests over a window: each Wait call drains the
+// bucket by one and, if it would go negative, sleeps for however long it
+// takes the bucket to refill at the effective rate (capacity / window). The
+// bucket starts full, so up to capacity requests pass without waiting before
+// any delay applies; the refill rate does not depend on how much of the
+// bucket remains.
+type leakyBucketLimiter struct {
+	window time.Duration
+
+	mu      sync.Mutex
+	global  *leakyBucket
+	perMeth map[string]*leakyBucket
+	caps    map[string]float64
+}
+
+type leakyBucket struct {
+	capacity  float64
+	remaining float64
+	last      time.Time
+}
+
+func newLeakyBucketLimiter(globalRate float64, methodCaps map[string]float64) *leakyBucketLimiter {
+	const window = time.Second
+
+	l := &leakyBucketLimiter{
+		window:  window,
+		perMeth: make(map[string]*leakyBucket, len(methodCaps)),
+		caps:    methodCaps,
+	}
+	if globalRate > 0 {
+		l.global = &leakyBucket{capacity: globalRate, remaining: globalRate, last: time.Now()}
+	}
+	return l
+}
+
+func (l *leakyBucketLimiter) Wait(ctx context.Context, method string) error {
+	var wait time.Duration
+
+	l.mu.Lock()
+	if l.global != nil {
+		wait = maxDuration(wait, l.drain(l.global))
+	}
+	if cap, ok := l.caps[method]; ok {
+		b, ok := l.perMeth[method]
+		if !ok {
+			b = &leakyBucket{capacity: cap, remaining: cap, last: time.Now()}
+			l.perMeth[method] = b
+		}
+		wait = maxDuration(wait, l.drain(b))
+	}
+	l.mu.Unlock()
+
+	if wait == 0 {
+		return nil
+	}
+
+	select {
+	case <-time.After(wait):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// drain refills b for elapsed time and takes one unit out of it, returning
+// how long the caller should wait if that drains it below zero. l.mu must
+// be held by the caller.
+func (l *leakyBucketLimiter) drain(b *leakyBucket) time.Duration {
+	if b.capacity <= 0 {
+		// A <= 0 cap means "block this method entirely". Don't let the
+		// effectiveRate division below see a zero denominator: that turns
+		// into +Inf, which truncates to a large *negative* time.Duration
+		// and would let requests through immediately instead of blocking.
+		return time.Duration(math.MaxInt64)
+	}
+
+	now := time.Now()
+	elapsed := now.Sub(b.last)
+	b.last = now
+
+	effectiveRate := b.capacity / l.window.Seconds()
+	b.remaining += effectiveRate * elapsed.Seconds()
+	if b.remaining > b.capacity {
+		b.remaining = b.capacity
+	}
+
+	b.remaining--
+	if b.remaining >= 0 {
+		return 0
+	}
+
+	// Bucket is drained: delay for however long it takes to refill one
+	// unit at the effective rate rather than rejecting the query outright.
+	wait := time.Duration(-b.remaining / effectiveRate * float64(time.Second))
+	b.remaining = 0
+	return wait
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestLeakyBucketDrainZeroCapacityBlocks(t *testing.T) {
+	l := &leakyBucketLimiter{window: time.Second}
+	b := &leakyBucket{capacity: 0, remaining: 0, last: time.Now()}
+
+	wait := l.drain(b)
+	if wait != time.Duration(math.MaxInt64) {
+		t.Fatalf("drain() with a zero-capacity bucket should block indefinitely, got wait=%s", wait)
+	}
+}
+
+func TestLeakyBucketDrainNegativeCapacityBlocks(t *testing.T) {
+	l := &leakyBucketLimiter{window: time.Second}
+	b := &leakyBucket{capacity: -5, remaining: -5, last: time.Now()}
+
+	wait := l.drain(b)
+	if wait != time.Duration(math.MaxInt64) {
+		t.Fatalf("drain() with a negative-capacity bucket should block indefinitely, got wait=%s", wait)
+	}
+}
+
+func TestLeakyBucketDrainAllowsWithinCapacity(t *testing.T) {
+	l := &leakyBucketLimiter{window: time.Second}
+	b := &leakyBucket{capacity: 10, remaining: 10, last: time.Now()}
+
+	for i := 0; i < 10; i++ {
+		if wait := l.drain(b); wait != 0 {
+			t.Fatalf("drain() call %d should not wait while remaining >= 0, got wait=%s", i, wait)
+		}
+	}
+}
+
+func TestLeakyBucketDrainWaitsOnceDrained(t *testing.T) {
+	l := &leakyBucketLimiter{window: time.Second}
+	b := &leakyBucket{capacity: 1, remaining: 1, last: time.Now()}
+
+	if wait := l.drain(b); wait != 0 {
+		t.Fatalf("first drain() should not wait, got wait=%s", wait)
+	}
+	if wait := l.drain(b); wait <= 0 {
+		t.Fatalf("second drain() should wait for the bucket to refill, got wait=%s", wait)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+)
+
+// Distributed mode lets N ethspam workers share one aggregate rate limit by
+// routing Wait calls through a coordinator process (started with
+// --ratelimit-serve) instead of limiting locally. The wire format is a tiny
+// hand-written gRPC service rather than a generated one: there's no protoc
+// toolchain wired into this repo yet, and jsonCodec below is a drop-in
+// substitute for the usual protobuf codec.
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+// jsonCodec implements grpc/encoding.Codec using encoding/json in place of
+// protobuf, since the Lease{Request,Response} messages have no .proto/.pb.go
+// counterpart.
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+func (jsonCodec) Name() string { return "json" }
+
+// leaseRequest asks the coordinator for permission to send one query for
+// Method.
+type leaseRequest struct {
+	Method string
+}
+
+// leaseResponse reports how long the coordinator's own limiter held the
+// Lease call before granting it. The wait happens on the coordinator, so the
+// caller may send as soon as the call returns.
+type leaseResponse struct {
+	WaitMillis int64
+}
+
+var limiterServiceDesc = grpc.ServiceDesc{
+	ServiceName: "ethspam.RateLimiter",
+	HandlerType: (*limiterServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Lease",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+				req := new(leaseRequest)
+				if err := dec(req); err != nil {
+					return nil, err
+				}
+				return srv.(*limiterServer).Lease(ctx, req)
+			},
+		},
+	},
+}
+
+// limiterServer backs the coordinator side: it runs one local limiter that
+// every connected ethspam process leases from, producing one aggregate,
+// global rate regardless of how many workers are dialed in.
+type limiterServer struct {
+	local limiter
+}
+
+func (s *limiterServer) Lease(ctx context.Context, req *leaseRequest) (*leaseResponse, error) {
+	start := time.Now()
+	if err := s.local.Wait(ctx, req.Method); err != nil {
+		return nil, err
+	}
+	return &leaseResponse{WaitMillis: time.Since(start).Milliseconds()}, nil
+}
+
+// serveRateLimitCoordinator starts a gRPC coordinator process on addr,
+// enforcing local against every Lease call it receives. It blocks until ctx
+// is done.
+func serveRateLimitCoordinator(ctx context.Context, addr string, local limiter) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	srv := grpc.NewServer()
+	srv.RegisterService(&limiterServiceDesc, &limiterServer{local: local})
+
+	go func() {
+		<-ctx.Done()
+		srv.GracefulStop()
+	}()
+
+	return srv.Serve(lis)
+}
+
+// distributedLimiter proxies Wait calls to a shared coordinator so multiple
+// ethspam processes enforce one aggregate rate. fallback is applied
+// in-process if the coordinator is unreachable, so a single flaky box
+// doesn't stall every worker's request rate.
+type distributedLimiter struct {
+	conn     *grpc.ClientConn
+	fallback limiter
+}
+
+func newDistributedLimiter(coordinatorAddr string, fallback limiter) (*distributedLimiter, error) {
+	conn, err := grpc.Dial(coordinatorAddr,
+		grpc.WithInsecure(),
+		grpc.WithDefaultCallOptions(grpc.CallContentSubtype(jsonCodec{}.Name())),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &distributedLimiter{conn: conn, fallback: fallback}, nil
+}
+
+func (d *distributedLimiter) Wait(ctx context.Context, method string) error {
+	resp := new(leaseResponse)
+	err := d.conn.Invoke(ctx, "/ethspam.RateLimiter/Lease", &leaseRequest{Method: method}, resp)
+	if err != nil {
+		// Coordinator is unreachable (or any other gRPC failure); don't let
+		// a dead remote limiter stop the worker entirely, just fall back to
+		// local limiting. Every node doing this silently would multiply the
+		// effective aggregate rate by the number of nodes, so log it.
+		log.Printf("ratelimit coordinator unreachable, falling back to local limiting: %s\n", err)
+		return d.fallback.Wait(ctx, method)
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// mismatches counts responses that diverged between the primary endpoint and
+// a shadow endpoint, tracked alongside counter.
+var mismatches int64
+
+// hexRe matches a 0x-prefixed hex string so its casing can be normalized
+// before comparing shadowed responses; providers disagree on upper vs lower
+// case hex digits even when the underlying value is identical.
+var hexRe = regexp.MustCompile(`^0x[0-9a-fA-F]*$`)
+
+// queryShadow sends queryBuf to endpoint and every address in shadows in
+// parallel, canonicalizes each response, and diffs them against endpoint's.
+// The query counts once toward counter if endpoint answered at all,
+// whether or not the shadows agree; divergences are tallied separately in mismatches and logged with the
+// exact request payload so they can be reproduced. method feeds the same
+// Prometheus vectors query() uses, so shadowed traffic (and divergences,
+// via the "mismatch" error class) shows up on /metrics like any other
+// request.
+func queryShadow(endpoint string, method string, shadows []string, queryBuf *bytes.Buffer) {
+	body := queryBuf.Bytes()
+	addrs := append([]string{endpoint}, shadows...)
+
+	inFlight.Inc()
+	defer inFlight.Dec()
+
+	start := time.Now()
+	bodies := make([][]byte, len(addrs))
+	statuses := make([]int, len(addrs))
+	var wg sync.WaitGroup
+	for i, addr := range addrs {
+		wg.Add(1)
+		go func(i int, addr string) {
+			defer wg.Done()
+			resp, err := http.Post(addr, "application/json", bytes.NewReader(body))
+			if err != nil {
+				if i == 0 {
+					errorsTotal.WithLabelValues(classifyErr(err)).Inc()
+				}
+				log.Printf("shadow error from %s: %s\n", addr, err)
+				return
+			}
+			defer resp.Body.Close()
+			statuses[i] = resp.StatusCode
+			b, err := io.ReadAll(resp.Body)
+			if err != nil {
+				log.Printf("shadow error reading %s: %s\n", addr, err)
+				return
+			}
+			bodies[i] = b
+		}(i, addr)
+	}
+	wg.Wait()
+	requestDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+
+	if statuses[0] != 0 {
+		httpStatusTotal.WithLabelValues(strconv.Itoa(statuses[0])).Inc()
+		if statuses[0] >= 500 {
+			errorsTotal.WithLabelValues("5xx").Inc()
+		}
+	}
+
+	if bodies[0] != nil {
+		atomic.AddInt64(&counter, 1)
+		requestsTotal.WithLabelValues(method).Inc()
+	}
+
+	canonical := make([][]byte, len(bodies))
+	for i, b := range bodies {
+		if b == nil {
+			continue
+		}
+		c, err := canonicalizeJSON(b, bytes.Contains(body, []byte(`"pending"`)))
+		if err != nil {
+			log.Printf("shadow error canonicalizing response from %s: %s\n", addrs[i], err)
+			continue
+		}
+		canonical[i] = c
+	}
+
+	for i := 1; i < len(canonical); i++ {
+		if canonical[i] == nil || canonical[0] == nil {
+			continue
+		}
+		if !bytes.Equal(canonical[0], canonical[i]) {
+			atomic.AddInt64(&mismatches, 1)
+			errorsTotal.WithLabelValues("mismatch").Inc()
+			log.Printf("shadow mismatch %s vs %s for request %s:\n  %s\n  %s\n",
+				addrs[0], addrs[i], strings.TrimSpace(string(body)), canonical[0], canonical[i])
+		}
+	}
+}
+
+// canonicalizeJSON parses a JSON-RPC response and re-serializes it with
+// object keys sorted and hex strings lowercased, so that two otherwise
+// equivalent responses compare equal byte-for-byte. If pending is set (the
+// original request used a "pending" block tag), blockNumber is also
+// stripped, since it's expected to be volatile for a pending-tagged query;
+// for any other request a blockNumber mismatch is a real divergence and
+// must not be canonicalized away.
+func canonicalizeJSON(body []byte, pending bool) ([]byte, error) {
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(canonicalizeValue(v, pending))
+}
+
+func canonicalizeValue(v interface{}, pending bool) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		if pending {
+			delete(t, "blockNumber")
+		}
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		out := make(map[string]interface{}, len(t))
+		for _, k := range keys {
+			out[k] = canonicalizeValue(t[k], pending)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, e := range t {
+			out[i] = canonicalizeValue(e, pending)
+		}
+		return out
+	case string:
+		if hexRe.MatchString(t) {
+			return strings.ToLower(t)
+		}
+		return t
+	default:
+		return t
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import "testing"
+
+func TestCanonicalizeJSONSortsKeys(t *testing.T) {
+	got, err := canonicalizeJSON([]byte(`{"b":1,"a":2}`), false)
+	if err != nil {
+		t.Fatalf("canonicalizeJSON: %s", err)
+	}
+	if string(got) != `{"a":2,"b":1}` {
+		t.Fatalf("canonicalizeJSON did not sort keys, got %s", got)
+	}
+}
+
+func TestCanonicalizeJSONLowercasesHex(t *testing.T) {
+	got, err := canonicalizeJSON([]byte(`{"hash":"0xABCDEF"}`), false)
+	if err != nil {
+		t.Fatalf("canonicalizeJSON: %s", err)
+	}
+	if string(got) != `{"hash":"0xabcdef"}` {
+		t.Fatalf("canonicalizeJSON did not lowercase hex, got %s", got)
+	}
+}
+
+func TestCanonicalizeJSONKeepsBlockNumberWhenNotPending(t *testing.T) {
+	got, err := canonicalizeJSON([]byte(`{"blockNumber":"0x1"}`), false)
+	if err != nil {
+		t.Fatalf("canonicalizeJSON: %s", err)
+	}
+	if string(got) != `{"blockNumber":"0x1"}` {
+		t.Fatalf("canonicalizeJSON stripped blockNumber for a non-pending request, got %s", got)
+	}
+}
+
+func TestCanonicalizeJSONStripsBlockNumberWhenPending(t *testing.T) {
+	got, err := canonicalizeJSON([]byte(`{"blockNumber":"0x1","result":"0x2"}`), true)
+	if err != nil {
+		t.Fatalf("canonicalizeJSON: %s", err)
+	}
+	if string(got) != `{"result":"0x2"}` {
+		t.Fatalf("canonicalizeJSON did not strip blockNumber for a pending request, got %s", got)
+	}
+}
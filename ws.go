@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// wsNotifications counts inbound eth_subscribe notifications, tracked
+// separately from counter since they aren't requests ethspam itself sent.
+var wsNotifications int64
+
+// subscriptionTypes are the eth_subscribe variants kept alive for the
+// lifetime of the process, mirroring go-ethereum's filters package.
+var subscriptionTypes = []string{"newHeads", "logs", "newPendingTransactions"}
+
+// runSubscriptions opens one persistent websocket connection to endpoint and
+// subscribes to every entry in subscriptionTypes, counting each inbound
+// notification toward wsNotifications. Subscriptions survive generator
+// state refreshes: this runs independently of the stateChannel loop and
+// only redials the socket itself if the connection drops.
+func runSubscriptions(ctx context.Context, endpoint string) {
+	for {
+		if err := subscribeOnce(ctx, endpoint); err != nil {
+			log.Printf("subscription error: %s\n", err)
+		}
+
+		select {
+		case <-time.After(2 * time.Second):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func subscribeOnce(ctx context.Context, endpoint string) error {
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("failed to dial %s: %w", endpoint, err)
+	}
+	defer conn.Close()
+
+	for i, typ := range subscriptionTypes {
+		req := fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"eth_subscribe","params":["%s"]}`, i, typ)
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(req)); err != nil {
+			return fmt.Errorf("failed to subscribe to %s: %w", typ, err)
+		}
+	}
+
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	for {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		if bytes.Contains(msg, []byte(`"eth_subscription"`)) {
+			atomic.AddInt64(&wsNotifications, 1)
+			wsNotificationsTotal.Inc()
+		}
+	}
+}
+
+// wsTransport is a pool of persistent websocket connections used to send
+// generated queries when --transport is ws or both, as an alternative to
+// the one-shot http.Post path in query().
+type wsTransport struct {
+	endpoint string
+
+	mu    sync.Mutex
+	conns []*websocket.Conn
+	next  int
+}
+
+func newWSTransport(ctx context.Context, endpoint string, size int) (*wsTransport, error) {
+	t := &wsTransport{endpoint: endpoint}
+	for i := 0; i < size; i++ {
+		conn, _, err := websocket.DefaultDialer.DialContext(ctx, endpoint, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to dial %s: %w", endpoint, err)
+		}
+		go drainWS(conn)
+		t.conns = append(t.conns, conn)
+	}
+	return t, nil
+}
+
+// drainWS reads and discards responses on a query connection so the socket
+// doesn't back up. Unlike the http path, responses here are not checked for
+// JSON-RPC errors or timed; only the writes are counted.
+func drainWS(conn *websocket.Conn) {
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+// query writes queryBuf to one of the pooled connections, round-robin. A
+// successful write counts toward counter and wsQueriesTotal; unlike the http
+// path, it is counted on send rather than on a received response.
+func (t *wsTransport) query(queryBuf *bytes.Buffer) {
+	t.mu.Lock()
+	conn := t.conns[t.next%len(t.conns)]
+	t.next++
+	t.mu.Unlock()
+
+	if err := conn.WriteMessage(websocket.TextMessage, queryBuf.Bytes()); err != nil {
+		wsQueriesTotal.WithLabelValues("error").Inc()
+		log.Printf("error: %s\n", err)
+		return
+	}
+	atomic.AddInt64(&counter, 1)
+	wsQueriesTotal.WithLabelValues("sent").Inc()
+}
+
+// isWebsocketEndpoint reports whether endpoint should be dialed over ws
+// rather than POSTed to over plain http.
+func isWebsocketEndpoint(endpoint string) bool {
+	return strings.HasPrefix(endpoint, "ws://") || strings.HasPrefix(endpoint, "wss://")
+}
+
+// httpEndpoint resolves the endpoint --transport=both's non-websocket
+// workers should POST to. httpOverride wins if set (--rpc-http); otherwise,
+// since wsEndpoint (--rpc) is required to be ws:// or wss:// in both mode,
+// it's translated to the matching http:// or https:// scheme so a single
+// --rpc value still works for providers that serve both off the same host.
+func httpEndpoint(wsEndpoint, httpOverride string) (string, error) {
+	if httpOverride != "" {
+		return httpOverride, nil
+	}
+
+	switch {
+	case strings.HasPrefix(wsEndpoint, "wss://"):
+		return "https://" + strings.TrimPrefix(wsEndpoint, "wss://"), nil
+	case strings.HasPrefix(wsEndpoint, "ws://"):
+		return "http://" + strings.TrimPrefix(wsEndpoint, "ws://"), nil
+	default:
+		return "", fmt.Errorf("cannot derive an http endpoint from %q; pass --rpc-http explicitly", wsEndpoint)
+	}
+}